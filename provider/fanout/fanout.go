@@ -0,0 +1,263 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fanout provides a provider.Alerts that multiplexes writes
+// across a primary and one or more secondary providers, modeled on
+// Prometheus's storage fanout.
+package fanout
+
+import (
+	"strings"
+
+	"github.com/prometheus/alertmanager/provider"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// alertChannelLength sizes the buffer used to relay a healed/merged
+// result set without blocking on a slow consumer.
+const alertChannelLength = 200
+
+// FanoutAlerts forwards every Put to a primary provider.Alerts and zero
+// or more secondaries, but serves Get, Subscribe and GetPending from the
+// primary, transparently healing in anything a secondary has that the
+// primary is missing. This lets mem.Alerts stay the hot path for reads
+// while a persistent or remote provider is kept eventually consistent
+// alongside it.
+type FanoutAlerts struct {
+	primary     provider.Alerts
+	secondaries []provider.Alerts
+}
+
+// NewFanoutAlerts returns a provider.Alerts backed by primary, mirroring
+// every Put to secondaries as well.
+func NewFanoutAlerts(primary provider.Alerts, secondaries ...provider.Alerts) *FanoutAlerts {
+	return &FanoutAlerts{
+		primary:     primary,
+		secondaries: secondaries,
+	}
+}
+
+// Put forwards alerts to the primary and every secondary. It always
+// writes to all backends rather than failing fast, returning a
+// MultiError so one failing backend doesn't stop the write reaching the
+// rest. The backends are written one after another, so a slow one still
+// delays those after it.
+func (f *FanoutAlerts) Put(alerts ...*types.Alert) error {
+	var merr MultiError
+
+	if err := f.primary.Put(alerts...); err != nil {
+		merr.Add(err)
+	}
+	for _, sec := range f.secondaries {
+		if err := sec.Put(alerts...); err != nil {
+			merr.Add(err)
+		}
+	}
+
+	return merr.Err()
+}
+
+// Get returns the alert for fp from the primary, falling back to the
+// secondaries in order if the primary doesn't have it.
+func (f *FanoutAlerts) Get(fp model.Fingerprint) (*types.Alert, error) {
+	alert, err := f.primary.Get(fp)
+	if err == nil {
+		return alert, nil
+	}
+	if err != provider.ErrNotFound {
+		return nil, err
+	}
+
+	for _, sec := range f.secondaries {
+		alert, err := sec.Get(fp)
+		if err == nil {
+			return alert, nil
+		}
+		if err != provider.ErrNotFound {
+			return nil, err
+		}
+	}
+
+	return nil, provider.ErrNotFound
+}
+
+// Subscribe subscribes to the primary's live alert stream, first healing
+// in any alerts a secondary currently has pending that the primary is
+// missing. Once that one-time heal pass is delivered, the primary's
+// stream is relayed unmodified, so listener fan-out semantics - each
+// alert seen by a subscriber exactly once - are preserved exactly as
+// mem.Alerts implements them.
+func (f *FanoutAlerts) Subscribe() provider.AlertIterator {
+	primary := f.primary.Subscribe()
+	healed := f.healMissing()
+
+	var (
+		ch   = make(chan *types.Alert, len(healed)+alertChannelLength)
+		done = make(chan struct{})
+	)
+
+	for _, alert := range healed {
+		ch <- alert
+	}
+
+	go func() {
+		defer close(ch)
+		defer primary.Close()
+		for {
+			select {
+			case alert, ok := <-primary.Next():
+				if !ok {
+					return
+				}
+				select {
+				case ch <- alert:
+				case <-done:
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return provider.NewAlertIterator(ch, done, primary.Err())
+}
+
+// GetPending returns the primary's pending alerts, healed with anything
+// a secondary currently has pending that the primary is missing.
+func (f *FanoutAlerts) GetPending() provider.AlertIterator {
+	seen := map[model.Fingerprint]*types.Alert{}
+
+	primaryAlerts, err := f.drainPrimaryPending()
+	for _, alert := range primaryAlerts {
+		seen[alert.Fingerprint()] = alert
+	}
+
+	if err == nil {
+		for fp, alert := range f.healMissingFrom(seen) {
+			seen[fp] = alert
+		}
+	}
+
+	alerts := make([]*types.Alert, 0, len(seen))
+	for _, alert := range seen {
+		alerts = append(alerts, alert)
+	}
+
+	ch := make(chan *types.Alert, len(alerts))
+	for _, alert := range alerts {
+		ch <- alert
+	}
+	close(ch)
+
+	return provider.NewAlertIterator(ch, make(chan struct{}), err)
+}
+
+// drainPrimaryPending fully reads the primary's current pending set.
+func (f *FanoutAlerts) drainPrimaryPending() ([]*types.Alert, error) {
+	it := f.primary.GetPending()
+	var alerts []*types.Alert
+	for alert := range it.Next() {
+		alerts = append(alerts, alert)
+	}
+	err := it.Err()
+	it.Close()
+	return alerts, err
+}
+
+// healMissing returns, from every secondary's current pending set, the
+// alerts whose fingerprint the primary doesn't have, in no particular
+// order; the first secondary wins on overlap.
+func (f *FanoutAlerts) healMissing() []*types.Alert {
+	missing := f.healMissingFrom(nil)
+	alerts := make([]*types.Alert, 0, len(missing))
+	for _, alert := range missing {
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// healMissingFrom returns, from every secondary's current pending set,
+// the alerts whose fingerprint is absent from both known and the
+// primary itself.
+func (f *FanoutAlerts) healMissingFrom(known map[model.Fingerprint]*types.Alert) map[model.Fingerprint]*types.Alert {
+	missing := map[model.Fingerprint]*types.Alert{}
+	for _, sec := range f.secondaries {
+		it := sec.GetPending()
+		for alert := range it.Next() {
+			fp := alert.Fingerprint()
+			if _, ok := known[fp]; ok {
+				continue
+			}
+			if _, ok := missing[fp]; ok {
+				continue
+			}
+			if _, err := f.primary.Get(fp); err != provider.ErrNotFound {
+				continue
+			}
+			missing[fp] = alert
+		}
+		it.Close()
+	}
+	return missing
+}
+
+// Close releases any resources held by the primary and every secondary
+// that implements a Close() error method - e.g. a persistent provider's
+// WAL file handle, or a remote provider's background puller and queue
+// manager - collecting every error encountered instead of stopping at
+// the first, the same as Put.
+func (f *FanoutAlerts) Close() error {
+	var merr MultiError
+	for _, a := range append([]provider.Alerts{f.primary}, f.secondaries...) {
+		if c, ok := a.(interface{ Close() error }); ok {
+			if err := c.Close(); err != nil {
+				merr.Add(err)
+			}
+		}
+	}
+	return merr.Err()
+}
+
+// MultiError is a list of errors surfaced as a single error, used so a
+// write to several backends can report every failure instead of just
+// the first one encountered.
+type MultiError []error
+
+// Add appends err to the list, if it is non-nil.
+func (es *MultiError) Add(err error) {
+	if err != nil {
+		*es = append(*es, err)
+	}
+}
+
+// Err returns nil if the list is empty, or the MultiError itself
+// otherwise.
+func (es MultiError) Err() error {
+	if len(es) == 0 {
+		return nil
+	}
+	return es
+}
+
+func (es MultiError) Error() string {
+	if len(es) == 1 {
+		return es[0].Error()
+	}
+	parts := make([]string, len(es))
+	for i, err := range es {
+		parts[i] = err.Error()
+	}
+	return strings.Join(parts, "; ")
+}
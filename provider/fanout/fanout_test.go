@@ -0,0 +1,131 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fanout
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/provider"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// fakeAlerts is a minimal provider.Alerts stand-in: GetPending and
+// Subscribe both just drain the current set through a closed channel,
+// with no live updates, which is enough to exercise FanoutAlerts' own
+// healing logic without needing a real mem.Alerts.
+type fakeAlerts struct {
+	alerts map[model.Fingerprint]*types.Alert
+}
+
+func newFakeAlerts(alerts ...*types.Alert) *fakeAlerts {
+	f := &fakeAlerts{alerts: map[model.Fingerprint]*types.Alert{}}
+	for _, a := range alerts {
+		f.alerts[a.Fingerprint()] = a
+	}
+	return f
+}
+
+func (f *fakeAlerts) Get(fp model.Fingerprint) (*types.Alert, error) {
+	a, ok := f.alerts[fp]
+	if !ok {
+		return nil, provider.ErrNotFound
+	}
+	return a, nil
+}
+
+func (f *fakeAlerts) Put(alerts ...*types.Alert) error {
+	for _, a := range alerts {
+		f.alerts[a.Fingerprint()] = a
+	}
+	return nil
+}
+
+func (f *fakeAlerts) drain() provider.AlertIterator {
+	ch := make(chan *types.Alert, len(f.alerts))
+	for _, a := range f.alerts {
+		ch <- a
+	}
+	close(ch)
+	return provider.NewAlertIterator(ch, make(chan struct{}), nil)
+}
+
+func (f *fakeAlerts) GetPending() provider.AlertIterator { return f.drain() }
+func (f *fakeAlerts) Subscribe() provider.AlertIterator  { return f.drain() }
+
+func newAlert(name string) *types.Alert {
+	return &types.Alert{
+		Alert: model.Alert{
+			Labels:   model.LabelSet{"alertname": model.LabelValue(name)},
+			StartsAt: time.Now(),
+			EndsAt:   time.Now().Add(time.Hour),
+		},
+	}
+}
+
+// TestGetPendingHealsFromSecondary checks that an alert only present in a
+// secondary's pending set is merged into the primary's.
+func TestGetPendingHealsFromSecondary(t *testing.T) {
+	onlyPrimary := newAlert("OnlyPrimary")
+	onlySecondary := newAlert("OnlySecondary")
+
+	primary := newFakeAlerts(onlyPrimary)
+	secondary := newFakeAlerts(onlySecondary)
+	f := NewFanoutAlerts(primary, secondary)
+
+	it := f.GetPending()
+	defer it.Close()
+
+	seen := map[model.Fingerprint]bool{}
+	for alert := range it.Next() {
+		seen[alert.Fingerprint()] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("GetPending: %s", err)
+	}
+
+	for _, want := range []*types.Alert{onlyPrimary, onlySecondary} {
+		if !seen[want.Fingerprint()] {
+			t.Fatalf("GetPending() missing %v healed from secondary", want.Fingerprint())
+		}
+	}
+}
+
+// TestSubscribeHealsFromSecondary checks the same healing for Subscribe.
+func TestSubscribeHealsFromSecondary(t *testing.T) {
+	onlyPrimary := newAlert("OnlyPrimary")
+	onlySecondary := newAlert("OnlySecondary")
+
+	primary := newFakeAlerts(onlyPrimary)
+	secondary := newFakeAlerts(onlySecondary)
+	f := NewFanoutAlerts(primary, secondary)
+
+	it := f.Subscribe()
+	defer it.Close()
+
+	seen := map[model.Fingerprint]bool{}
+	for alert := range it.Next() {
+		seen[alert.Fingerprint()] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Subscribe: %s", err)
+	}
+
+	for _, want := range []*types.Alert{onlyPrimary, onlySecondary} {
+		if !seen[want.Fingerprint()] {
+			t.Fatalf("Subscribe() missing %v healed from secondary", want.Fingerprint())
+		}
+	}
+}
@@ -14,9 +14,11 @@
 package mem
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
+	"github.com/prometheus/alertmanager/pkg/labels"
 	"github.com/prometheus/alertmanager/provider"
 	"github.com/prometheus/alertmanager/types"
 	"github.com/prometheus/common/model"
@@ -24,6 +26,73 @@ import (
 
 const alertChannelLength = 200
 
+const (
+	// defaultResolvedRetention is how long a resolved alert is kept
+	// around after EndsAt before runGC evicts it, if not overridden via
+	// WithResolvedRetention.
+	defaultResolvedRetention = 5 * time.Minute
+	// defaultForGracePeriod is how long after resolution a reappearing
+	// alert is still considered the same firing interval, if not
+	// overridden via WithForGracePeriod.
+	defaultForGracePeriod = 5 * time.Minute
+)
+
+// Backend is a pluggable durable store that Alerts can keep in sync with
+// its in-memory index. It lets a caller compose the fast in-memory path
+// with a crash-safe backend (see NewPersistentAlerts) without Alerts
+// itself knowing anything about persistence.
+type Backend interface {
+	// Put persists the given alerts.
+	Put(...*types.Alert) error
+	// Delete removes the alert with the given fingerprint, e.g. once
+	// runGC has evicted it from the in-memory index.
+	Delete(model.Fingerprint) error
+	// Load returns all alerts currently held by the backend. It is
+	// called once on construction to repopulate the in-memory index.
+	Load() ([]*types.Alert, error)
+	// Close releases any resources held by the backend.
+	Close() error
+}
+
+// Option configures an Alerts on construction.
+type Option func(*Alerts) error
+
+// WithBackend plugs a durable Backend into Alerts. Every Put is mirrored
+// to the backend before it is acknowledged, and the in-memory index is
+// seeded from the backend's Load on startup.
+func WithBackend(b Backend) Option {
+	return func(a *Alerts) error {
+		a.backend = b
+		return nil
+	}
+}
+
+// WithResolvedRetention overrides how long a resolved alert is kept
+// around after EndsAt before runGC evicts it. While retained, Get still
+// returns it and Subscribe still replays it to new listeners, giving
+// operators a queryable short-term history of recently resolved alerts.
+// It must be at least as long as ForGracePeriod - see WithForGracePeriod.
+func WithResolvedRetention(d time.Duration) Option {
+	return func(a *Alerts) error {
+		a.resolvedRetention = d
+		return nil
+	}
+}
+
+// WithForGracePeriod overrides the window, borrowed from Prometheus's
+// rules manager, within which an alert that fires again after being
+// resolved is still considered the same incident: Put restores its
+// original StartsAt instead of starting a new firing interval, so
+// downstream notifiers can correctly deduplicate a flapping alert. This
+// only works while the resolved alert is still in the set, so
+// NewAlerts rejects a ForGracePeriod longer than ResolvedRetention.
+func WithForGracePeriod(d time.Duration) Option {
+	return func(a *Alerts) error {
+		a.forGracePeriod = d
+		return nil
+	}
+}
+
 // Alerts gives access to a set of alerts. All methods are goroutine-safe.
 type Alerts struct {
 	mtx        sync.RWMutex
@@ -33,23 +102,62 @@ type Alerts struct {
 	stopGC     chan struct{}
 	listeners  map[int]listeningAlerts
 	next       int
+
+	// backendMtx serializes every backend.Put in Put against
+	// withBackendLock, so a Backend's own background compaction can
+	// never observe a snapshot of a.alerts that is missing a write the
+	// backend itself already has - see walBackend.run.
+	backendMtx        sync.Mutex
+	backend           Backend
+	resolvedRetention time.Duration
+	forGracePeriod    time.Duration
+
+	postings postings
 }
 
 type listeningAlerts struct {
-	alerts chan *types.Alert
-	done   chan struct{}
+	alerts   chan *types.Alert
+	done     chan struct{}
+	matchers []*labels.Matcher
 }
 
-// NewAlerts returns a new alert provider.
-func NewAlerts(m types.Marker, intervalGC time.Duration) (*Alerts, error) {
+// NewAlerts returns a new alert provider. If a Backend is supplied via
+// WithBackend, the in-memory index is seeded from it before the GC loop
+// starts, and subsequent writes and evictions are mirrored to it.
+func NewAlerts(m types.Marker, intervalGC time.Duration, opts ...Option) (*Alerts, error) {
 	a := &Alerts{
-		alerts:     map[model.Fingerprint]*types.Alert{},
-		marker:     m,
-		intervalGC: intervalGC,
-		stopGC:     make(chan struct{}),
-		listeners:  map[int]listeningAlerts{},
-		next:       0,
+		alerts:            map[model.Fingerprint]*types.Alert{},
+		marker:            m,
+		intervalGC:        intervalGC,
+		stopGC:            make(chan struct{}),
+		listeners:         map[int]listeningAlerts{},
+		next:              0,
+		resolvedRetention: defaultResolvedRetention,
+		forGracePeriod:    defaultForGracePeriod,
+		postings:          postings{},
 	}
+	for _, opt := range opts {
+		if err := opt(a); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.forGracePeriod > a.resolvedRetention {
+		return nil, fmt.Errorf("mem: ForGracePeriod (%s) must not exceed ResolvedRetention (%s), or runGC evicts a resolved alert before the grace period that's supposed to dedupe its flap can elapse", a.forGracePeriod, a.resolvedRetention)
+	}
+
+	if a.backend != nil {
+		alerts, err := a.backend.Load()
+		if err != nil {
+			return nil, fmt.Errorf("load backend: %w", err)
+		}
+		for _, alert := range alerts {
+			fp := alert.Fingerprint()
+			a.alerts[fp] = alert
+			a.postings.add(fp, alert.Labels)
+		}
+	}
+
 	go a.runGC()
 
 	return a, nil
@@ -65,13 +173,19 @@ func (a *Alerts) runGC() {
 
 		a.mtx.Lock()
 
+		now := time.Now()
 		for fp, alert := range a.alerts {
-			// As we don't persist alerts, we no longer consider them after
-			// they are resolved. Alerts waiting for resolved notifications are
-			// held in memory in aggregation groups redundantly.
-			if alert.EndsAt.Before(time.Now()) {
+			// Keep a resolved alert around for ResolvedRetention so Get
+			// can still answer for it and Subscribe can still replay it
+			// to new listeners, giving operators a short-term history
+			// without needing the full persistent backend.
+			if alert.EndsAt.Before(now.Add(-a.resolvedRetention)) {
 				delete(a.alerts, fp)
+				a.postings.remove(fp, alert.Labels)
 				a.marker.Delete(fp)
+				if a.backend != nil {
+					a.backend.Delete(fp)
+				}
 			}
 		}
 
@@ -92,6 +206,9 @@ func (a *Alerts) runGC() {
 // Close the alert provider.
 func (a *Alerts) Close() error {
 	close(a.stopGC)
+	if a.backend != nil {
+		return a.backend.Close()
+	}
 	return nil
 }
 
@@ -106,6 +223,14 @@ func max(a, b int) int {
 // resolved and successfully notified about.
 // They are not guaranteed to be in chronological order.
 func (a *Alerts) Subscribe() provider.AlertIterator {
+	return a.SubscribeFiltered()
+}
+
+// SubscribeFiltered is like Subscribe, but only delivers alerts matching
+// every one of the given matchers to the new listener, so a caller that
+// only cares about a subset of alerts - the API's filtered list endpoint,
+// or silence matching - doesn't have to discard the rest itself.
+func (a *Alerts) SubscribeFiltered(matchers ...*labels.Matcher) provider.AlertIterator {
 	alerts, err := a.getPending()
 
 	var (
@@ -113,14 +238,16 @@ func (a *Alerts) Subscribe() provider.AlertIterator {
 		done = make(chan struct{})
 	)
 
-	for _, a := range alerts {
-		ch <- a
+	for _, alert := range alerts {
+		if matchesAll(alert, matchers) {
+			ch <- alert
+		}
 	}
 
 	a.mtx.Lock()
 	i := a.next
 	a.next++
-	a.listeners[i] = listeningAlerts{alerts: ch, done: done}
+	a.listeners[i] = listeningAlerts{alerts: ch, done: done, matchers: matchers}
 	a.mtx.Unlock()
 
 	return provider.NewAlertIterator(ch, done, err)
@@ -151,17 +278,135 @@ func (a *Alerts) GetPending() provider.AlertIterator {
 	return provider.NewAlertIterator(ch, done, err)
 }
 
+// matchesAll reports whether alert's labels satisfy every matcher. A nil
+// or empty matcher set always matches.
+func matchesAll(alert *types.Alert, matchers []*labels.Matcher) bool {
+	for _, m := range matchers {
+		if !m.Matches(string(alert.Labels[model.LabelName(m.Name)])) {
+			return false
+		}
+	}
+	return true
+}
+
+// Query returns an iterator over the alerts satisfying every one of the
+// given matchers. Candidates are narrowed through the label postings
+// index when the matchers include an equality matcher on a non-empty
+// value; otherwise the full alert set is scanned.
+func (a *Alerts) Query(matchers ...*labels.Matcher) provider.AlertIterator {
+	alerts, err := a.getMatching(matchers)
+
+	var (
+		ch   = make(chan *types.Alert, alertChannelLength)
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(ch)
+
+		for _, alert := range alerts {
+			select {
+			case ch <- alert:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return provider.NewAlertIterator(ch, done, err)
+}
+
+// getMatching returns every alert satisfying every one of matchers. It
+// must return exactly the alerts matchesAll would pick out of a full
+// scan - the postings index intersected over matchers' equality matchers
+// only narrows the set of candidates that a final matchesAll pass then
+// filters, so a matcher that can also match an absent label (e.g.
+// MatchNotEqual, MatchRegexp, MatchNotRegexp) is never resolved purely
+// from the index, where such an alert would never have been indexed.
+func (a *Alerts) getMatching(matchers []*labels.Matcher) ([]*types.Alert, error) {
+	a.mtx.RLock()
+	defer a.mtx.RUnlock()
+
+	candidates := a.alerts
+	if fps := a.equalityCandidates(matchers); fps != nil {
+		candidates = make(map[model.Fingerprint]*types.Alert, len(fps))
+		for fp := range fps {
+			if alert, ok := a.alerts[fp]; ok {
+				candidates[fp] = alert
+			}
+		}
+	}
+
+	alerts := make([]*types.Alert, 0, len(candidates))
+	for _, alert := range candidates {
+		if matchesAll(alert, matchers) {
+			alerts = append(alerts, alert)
+		}
+	}
+	return alerts, nil
+}
+
+// equalityCandidates narrows the search to the fingerprints satisfying
+// every labels.MatchEqual matcher with a non-empty value in matchers, via
+// the postings index. It returns nil if matchers contains no such
+// matcher, since in that case the index can't narrow anything down
+// without risking dropping an alert that matchesAll would have kept (an
+// equality matcher on "" also matches an alert lacking the label).
+func (a *Alerts) equalityCandidates(matchers []*labels.Matcher) map[model.Fingerprint]struct{} {
+	var fps map[model.Fingerprint]struct{}
+	for _, m := range matchers {
+		if m.Type != labels.MatchEqual || m.Value == "" {
+			continue
+		}
+		matching := a.postings.matchingEqual(m)
+		if fps == nil {
+			fps = matching
+			continue
+		}
+		for fp := range fps {
+			if _, ok := matching[fp]; !ok {
+				delete(fps, fp)
+			}
+		}
+	}
+	return fps
+}
+
 func (a *Alerts) getPending() ([]*types.Alert, error) {
 	a.mtx.RLock()
 	defer a.mtx.RUnlock()
 
+	return a.getPendingLocked(), nil
+}
+
+// getPendingLocked returns every alert currently in the set. The caller
+// must hold at least a.mtx.RLock().
+func (a *Alerts) getPendingLocked() []*types.Alert {
 	res := make([]*types.Alert, 0, len(a.alerts))
 
 	for _, alert := range a.alerts {
 		res = append(res, alert)
 	}
 
-	return res, nil
+	return res
+}
+
+// withBackendLock runs f against a point-in-time copy of every alert
+// currently in the set, with backendMtx held for the duration so no
+// concurrent Put can land a write in the Backend that isn't yet
+// reflected in that copy. Callers outside this package's Put/runGC
+// critical sections - e.g. a Backend's own background compaction - that
+// need a live-set snapshot consistent with everything already written to
+// the backend should use this instead of reading a.alerts directly.
+func (a *Alerts) withBackendLock(f func(live []*types.Alert) error) error {
+	a.backendMtx.Lock()
+	defer a.backendMtx.Unlock()
+
+	a.mtx.RLock()
+	live := a.getPendingLocked()
+	a.mtx.RUnlock()
+
+	return f(live)
 }
 
 // Get returns the alert for a given fingerprint.
@@ -178,13 +423,39 @@ func (a *Alerts) Get(fp model.Fingerprint) (*types.Alert, error) {
 
 // Put adds the given alert to the set.
 func (a *Alerts) Put(alerts ...*types.Alert) error {
+	// backendMtx, not a.mtx, guards the backend write: a.mtx is also what
+	// every Get/Query/Subscribe takes, so holding it across a write that
+	// can involve a disk fsync would block every reader for the duration
+	// of the I/O. backendMtx stays held until the in-memory update below
+	// lands, so a concurrent Backend compaction (withBackendLock) can
+	// never see a snapshot that's missing a write the backend already
+	// has.
+	a.backendMtx.Lock()
+	defer a.backendMtx.Unlock()
+
+	if a.backend != nil {
+		if err := a.backend.Put(alerts...); err != nil {
+			return fmt.Errorf("write backend: %w", err)
+		}
+	}
+
 	a.mtx.Lock()
 	defer a.mtx.Unlock()
 
+	now := time.Now()
 	for _, alert := range alerts {
 		fp := alert.Fingerprint()
 
-		if old, ok := a.alerts[fp]; ok {
+		old, existed := a.alerts[fp]
+		if existed {
+			// The alert resolved and is now firing again within
+			// ForGracePeriod of that resolution: treat it as a
+			// continuation of the same incident rather than a new one,
+			// so downstream notifiers can dedupe the flap correctly.
+			if old.EndsAt.Before(now) && alert.EndsAt.After(now) && now.Sub(old.EndsAt) <= a.forGracePeriod {
+				alert.StartsAt = old.StartsAt
+			}
+
 			// Merge alerts if there is an overlap in activity range.
 			if (alert.EndsAt.After(old.StartsAt) && alert.EndsAt.Before(old.EndsAt)) ||
 				(alert.StartsAt.After(old.StartsAt) && alert.StartsAt.Before(old.EndsAt)) {
@@ -193,8 +464,14 @@ func (a *Alerts) Put(alerts ...*types.Alert) error {
 		}
 
 		a.alerts[fp] = alert
+		if !existed {
+			a.postings.add(fp, alert.Labels)
+		}
 
 		for _, l := range a.listeners {
+			if !matchesAll(alert, l.matchers) {
+				continue
+			}
 			select {
 			case l.alerts <- alert:
 			case <-l.done:
@@ -0,0 +1,83 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// TestNewAlertsRejectsForGracePeriodLongerThanResolvedRetention guards
+// against a configuration where runGC would evict a resolved alert
+// before ForGracePeriod elapses, silently disabling flap dedup.
+func TestNewAlertsRejectsForGracePeriodLongerThanResolvedRetention(t *testing.T) {
+	_, err := NewAlerts(nil, time.Hour,
+		WithResolvedRetention(time.Minute),
+		WithForGracePeriod(2*time.Minute),
+	)
+	if err == nil {
+		t.Fatal("NewAlerts succeeded with ForGracePeriod > ResolvedRetention, want an error")
+	}
+}
+
+// TestPutRestoresStartsAtWithinGracePeriod checks that an alert
+// re-firing within ForGracePeriod of its own resolution is treated as a
+// continuation of the same incident rather than a new one.
+func TestPutRestoresStartsAtWithinGracePeriod(t *testing.T) {
+	a, err := NewAlerts(nil, time.Hour,
+		WithResolvedRetention(time.Hour),
+		WithForGracePeriod(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("NewAlerts: %s", err)
+	}
+	defer a.Close()
+
+	labels := model.LabelSet{"alertname": "Foo"}
+	start := time.Now().Add(-time.Hour)
+	resolvedAt := time.Now().Add(-time.Minute)
+
+	original := &types.Alert{
+		Alert: model.Alert{
+			Labels:   labels,
+			StartsAt: start,
+			EndsAt:   resolvedAt,
+		},
+	}
+	if err := a.Put(original); err != nil {
+		t.Fatalf("Put (original): %s", err)
+	}
+
+	reFired := &types.Alert{
+		Alert: model.Alert{
+			Labels:   labels,
+			StartsAt: time.Now(),
+			EndsAt:   time.Now().Add(time.Hour),
+		},
+	}
+	if err := a.Put(reFired); err != nil {
+		t.Fatalf("Put (re-fired): %s", err)
+	}
+
+	got, err := a.Get(reFired.Fingerprint())
+	if err != nil {
+		t.Fatalf("Get: %s", err)
+	}
+	if !got.StartsAt.Equal(start) {
+		t.Fatalf("StartsAt = %s, want original incident's StartsAt %s", got.StartsAt, start)
+	}
+}
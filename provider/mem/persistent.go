@@ -0,0 +1,161 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const defaultFsyncInterval = 1 * time.Second
+
+// WithFsyncInterval overrides how often buffered WAL writes are flushed
+// and fsynced to disk. Smaller intervals shrink the window of acknowledged
+// alerts that could be lost to a hard crash, at the cost of write
+// throughput. It only applies to an Alerts constructed via
+// NewPersistentAlerts.
+func WithFsyncInterval(d time.Duration) Option {
+	return func(a *Alerts) error {
+		b, ok := a.backend.(*walBackend)
+		if !ok {
+			return fmt.Errorf("mem: WithFsyncInterval requires a walBackend; use NewPersistentAlerts")
+		}
+		b.fsyncInterval = d
+		return nil
+	}
+}
+
+// WithErrorHandler registers f to be called whenever a background fsync
+// or compaction against the write-ahead log fails, so a disk-full or I/O
+// error on this otherwise-silent path is observable instead of just
+// being retried forever on the next tick. It only applies to an Alerts
+// constructed via NewPersistentAlerts.
+func WithErrorHandler(f func(error)) Option {
+	return func(a *Alerts) error {
+		b, ok := a.backend.(*walBackend)
+		if !ok {
+			return fmt.Errorf("mem: WithErrorHandler requires a walBackend; use NewPersistentAlerts")
+		}
+		b.onError = f
+		return nil
+	}
+}
+
+// walBackend is a Backend that mirrors every write to a segmented,
+// crash-safe write-ahead log on disk.
+type walBackend struct {
+	wal *wal
+
+	fsyncInterval   time.Duration
+	compactInterval time.Duration
+	onError         func(error)
+
+	stop chan struct{}
+}
+
+func (b *walBackend) reportError(err error) {
+	if b.onError != nil {
+		b.onError(err)
+	}
+}
+
+func (b *walBackend) Put(alerts ...*types.Alert) error {
+	return b.wal.Append(alerts...)
+}
+
+func (b *walBackend) Delete(fp model.Fingerprint) error {
+	return b.wal.Delete(fp)
+}
+
+func (b *walBackend) Load() ([]*types.Alert, error) {
+	return b.wal.Replay()
+}
+
+func (b *walBackend) Close() error {
+	close(b.stop)
+	return b.wal.Close()
+}
+
+// run drives two independent tickers: fsyncInterval flushes buffered WAL
+// writes to disk, while compactInterval - tied to the GC interval passed
+// to NewPersistentAlerts, not to fsyncInterval - rewrites the log down to
+// the alerts runGC still considers live. Compaction is a full rewrite of
+// every live alert, so it must not run any more often than GC actually
+// changes what's live.
+func (b *walBackend) run(a *Alerts) {
+	fsync := time.NewTicker(b.fsyncInterval)
+	defer fsync.Stop()
+
+	compact := time.NewTicker(b.compactInterval)
+	defer compact.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-fsync.C:
+			if err := b.wal.Sync(); err != nil {
+				b.reportError(fmt.Errorf("sync wal: %w", err))
+			}
+		case <-compact.C:
+			err := a.withBackendLock(func(live []*types.Alert) error {
+				return b.wal.Compact(live)
+			})
+			if err != nil {
+				b.reportError(fmt.Errorf("compact wal: %w", err))
+			}
+		}
+	}
+}
+
+// NewPersistentAlerts returns a provider.Alerts backed by a write-ahead
+// log rooted at dir. Every Put is appended to the log's in-memory write
+// buffer before it is acknowledged; the buffer is flushed and fsynced to
+// disk once per fsync interval (see WithFsyncInterval), so writes
+// acknowledged since the last fsync are lost if the process or host
+// crashes. On startup the log is replayed to restore live alerts
+// so a restarted Alertmanager doesn't drop in-flight alerts or their
+// StartsAt/notification state. A background loop periodically compacts
+// the log down to the alerts runGC still considers live.
+//
+// opts accepts both the usual mem.Options (WithResolvedRetention,
+// WithForGracePeriod, ...) and the persistence-specific WithFsyncInterval
+// and WithErrorHandler. NewPersistentAlerts supplies its own WithBackend;
+// opts should not include one of its own.
+func NewPersistentAlerts(dir string, m types.Marker, intervalGC time.Duration, opts ...Option) (*Alerts, error) {
+	w, err := openWAL(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &walBackend{
+		wal:             w,
+		fsyncInterval:   defaultFsyncInterval,
+		compactInterval: intervalGC,
+		stop:            make(chan struct{}),
+	}
+
+	allOpts := append([]Option{WithBackend(backend)}, opts...)
+	a, err := NewAlerts(m, intervalGC, allOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	go backend.run(a)
+
+	return a, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/common/model"
+)
+
+// postings indexes alerts by label name/value pair so Query can answer a
+// set of matchers without scanning every alert. It is not goroutine-safe
+// on its own; callers mutate and read it under Alerts.mtx.
+type postings map[string]map[string]map[model.Fingerprint]struct{}
+
+// add indexes fp under every name/value pair in lbls.
+func (p postings) add(fp model.Fingerprint, lbls model.LabelSet) {
+	for name, value := range lbls {
+		byValue, ok := p[string(name)]
+		if !ok {
+			byValue = map[string]map[model.Fingerprint]struct{}{}
+			p[string(name)] = byValue
+		}
+		fps, ok := byValue[string(value)]
+		if !ok {
+			fps = map[model.Fingerprint]struct{}{}
+			byValue[string(value)] = fps
+		}
+		fps[fp] = struct{}{}
+	}
+}
+
+// remove drops fp from the postings for every name/value pair in lbls,
+// clearing empty entries behind it so a long-lived Alertmanager doesn't
+// accumulate postings for label values no alert holds any more.
+func (p postings) remove(fp model.Fingerprint, lbls model.LabelSet) {
+	for name, value := range lbls {
+		byValue, ok := p[string(name)]
+		if !ok {
+			continue
+		}
+		fps, ok := byValue[string(value)]
+		if !ok {
+			continue
+		}
+		delete(fps, fp)
+		if len(fps) == 0 {
+			delete(byValue, string(value))
+		}
+		if len(byValue) == 0 {
+			delete(p, string(name))
+		}
+	}
+}
+
+// matchingEqual returns the fingerprints of every alert whose label
+// m.Name equals m.Value, read straight off the postings. It is only
+// correct for m.Type == labels.MatchEqual with a non-empty m.Value:
+// anything else (MatchEqual on "", MatchNotEqual, MatchRegexp,
+// MatchNotRegexp) can also match an alert that doesn't have
+// the label at all, and the postings index has no entry to find such an
+// alert under, so that case is handled by a full scan in
+// Alerts.getMatching instead, matching matchesAll's semantics exactly.
+func (p postings) matchingEqual(m *labels.Matcher) map[model.Fingerprint]struct{} {
+	result := map[model.Fingerprint]struct{}{}
+
+	byValue, ok := p[m.Name]
+	if !ok {
+		return result
+	}
+	for fp := range byValue[m.Value] {
+		result[fp] = struct{}{}
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/alertmanager/pkg/labels"
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// TestQueryMatchesAbsentLabel guards against the postings index silently
+// dropping alerts that lack the matched label entirely: severity!=critical
+// must match an alert with no severity label at all, same as a full scan
+// via matchesAll would.
+func TestQueryMatchesAbsentLabel(t *testing.T) {
+	a, err := NewAlerts(nil, time.Hour)
+	if err != nil {
+		t.Fatalf("NewAlerts: %s", err)
+	}
+	defer a.Close()
+
+	withSeverity := &types.Alert{
+		Alert: model.Alert{
+			Labels:   model.LabelSet{"alertname": "Foo", "severity": "critical"},
+			StartsAt: time.Now(),
+			EndsAt:   time.Now().Add(time.Hour),
+		},
+	}
+	withoutSeverity := &types.Alert{
+		Alert: model.Alert{
+			Labels:   model.LabelSet{"alertname": "Bar"},
+			StartsAt: time.Now(),
+			EndsAt:   time.Now().Add(time.Hour),
+		},
+	}
+
+	if err := a.Put(withSeverity, withoutSeverity); err != nil {
+		t.Fatalf("Put: %s", err)
+	}
+
+	m, err := labels.NewMatcher(labels.MatchNotEqual, "severity", "critical")
+	if err != nil {
+		t.Fatalf("NewMatcher: %s", err)
+	}
+
+	it := a.Query(m)
+	defer it.Close()
+
+	var got []model.Fingerprint
+	for alert := range it.Next() {
+		got = append(got, alert.Fingerprint())
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Query: %s", err)
+	}
+
+	want := withoutSeverity.Fingerprint()
+	if len(got) != 1 || got[0] != want {
+		t.Fatalf(`Query(severity!="critical") = %v, want [%v] (only the alert missing the label)`, got, want)
+	}
+}
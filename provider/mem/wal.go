@@ -0,0 +1,317 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mem
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+const (
+	walSegmentPrefix  = "wal-"
+	walMaxSegmentSize = 64 * 1024 * 1024 // Cut a new segment once the current one grows past this.
+)
+
+// walRecord is a single entry appended to the write-ahead log. A
+// Tombstone record makes Replay drop every earlier record for FP.
+type walRecord struct {
+	FP        model.Fingerprint
+	Alert     *types.Alert
+	Tombstone bool
+}
+
+// countingWriter tracks the cumulative number of bytes written through it,
+// independent of any buffering downstream - so the count reflects what the
+// encoder has attempted to write, not what has actually reached disk.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// wal is a crash-safe, append-only segmented log of walRecords. Writers
+// buffer in memory and only fsync when Sync is called, so callers that
+// need a durability guarantee should pair Append with a Sync on the
+// interval set by walBackend.fsyncInterval.
+type wal struct {
+	mtx sync.Mutex
+	dir string
+
+	cur *os.File
+	bw  *bufio.Writer
+	cw  *countingWriter
+	enc *gob.Encoder
+}
+
+func openWAL(dir string) (*wal, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, fmt.Errorf("create wal dir: %w", err)
+	}
+	w := &wal{dir: dir}
+	if err := w.cutSegment(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *wal) segmentNames() ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), walSegmentPrefix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// nextSegmentIndex returns the sequence number one past the highest
+// numbered segment in segs, so any new segment - cut or compacted -
+// always sorts after every segment that already exists.
+func nextSegmentIndex(segs []string) int {
+	next := 0
+	if n := len(segs); n > 0 {
+		if idx, err := strconv.Atoi(strings.TrimPrefix(segs[n-1], walSegmentPrefix)); err == nil {
+			next = idx + 1
+		}
+	}
+	return next
+}
+
+// cutSegment flushes and closes the current segment, if any, and opens
+// the next one in sequence. The caller must hold w.mtx.
+func (w *wal) cutSegment() error {
+	if w.cur != nil {
+		if err := w.flushLocked(); err != nil {
+			return err
+		}
+		if err := w.cur.Close(); err != nil {
+			return err
+		}
+	}
+
+	segs, err := w.segmentNames()
+	if err != nil {
+		return err
+	}
+	next := nextSegmentIndex(segs)
+
+	f, err := os.OpenFile(filepath.Join(w.dir, fmt.Sprintf("%s%08d", walSegmentPrefix, next)), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	w.cur = f
+	w.bw = bufio.NewWriter(f)
+	w.cw = &countingWriter{w: w.bw}
+	w.enc = gob.NewEncoder(w.cw)
+	return nil
+}
+
+// Append writes alerts to the current segment's in-memory buffer.
+func (w *wal) Append(alerts ...*types.Alert) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	for _, alert := range alerts {
+		if err := w.enc.Encode(walRecord{FP: alert.Fingerprint(), Alert: alert}); err != nil {
+			return err
+		}
+	}
+	if w.cw.n > walMaxSegmentSize {
+		return w.cutSegment()
+	}
+	return nil
+}
+
+// Delete appends a tombstone for fp so Replay drops its earlier records.
+func (w *wal) Delete(fp model.Fingerprint) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.enc.Encode(walRecord{FP: fp, Tombstone: true})
+}
+
+// Sync flushes the buffered writes of the current segment to disk and
+// fsyncs it.
+func (w *wal) Sync() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	return w.syncLocked()
+}
+
+func (w *wal) syncLocked() error {
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	return w.cur.Sync()
+}
+
+func (w *wal) flushLocked() error {
+	return w.bw.Flush()
+}
+
+// Replay reads every segment in order and reconstructs the set of live
+// alerts, applying tombstones and dropping anything that has already
+// resolved past EndsAt.
+func (w *wal) Replay() ([]*types.Alert, error) {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if err := w.flushLocked(); err != nil {
+		return nil, err
+	}
+
+	segs, err := w.segmentNames()
+	if err != nil {
+		return nil, err
+	}
+
+	live := map[model.Fingerprint]*types.Alert{}
+	now := time.Now()
+
+	for _, seg := range segs {
+		f, err := os.Open(filepath.Join(w.dir, seg))
+		if err != nil {
+			return nil, err
+		}
+		dec := gob.NewDecoder(bufio.NewReader(f))
+		for {
+			var rec walRecord
+			if err := dec.Decode(&rec); err != nil {
+				break // EOF, or a torn write at the tail of the active segment.
+			}
+			if rec.Tombstone {
+				delete(live, rec.FP)
+				continue
+			}
+			live[rec.FP] = rec.Alert
+		}
+		f.Close()
+	}
+
+	alerts := make([]*types.Alert, 0, len(live))
+	for fp, alert := range live {
+		if alert.EndsAt.Before(now) {
+			delete(live, fp)
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// Compact rewrites the log down to a single segment holding only the
+// given alerts, dropping everything else - resolved alerts the GC loop
+// has already evicted, and any tombstones or superseded versions that
+// accumulated since the last compaction. The new segment is always given
+// a higher sequence number than any segment it replaces, never 0: if the
+// process crashes after the rename below but before the old segments are
+// removed, Replay must still process the stale leftovers first and the
+// fresh compacted segment last, so the compacted state wins instead of
+// being overwritten by what it just superseded.
+func (w *wal) Compact(live []*types.Alert) error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	if err := w.cur.Close(); err != nil {
+		return err
+	}
+
+	segs, err := w.segmentNames()
+	if err != nil {
+		return err
+	}
+	next := nextSegmentIndex(segs)
+
+	tmp, err := os.OpenFile(filepath.Join(w.dir, "compact.tmp"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(tmp)
+	enc := gob.NewEncoder(bw)
+	for _, alert := range live {
+		if err := enc.Encode(walRecord{FP: alert.Fingerprint(), Alert: alert}); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	newName := filepath.Join(w.dir, fmt.Sprintf("%s%08d", walSegmentPrefix, next))
+	if err := os.Rename(filepath.Join(w.dir, "compact.tmp"), newName); err != nil {
+		return err
+	}
+	for _, seg := range segs {
+		if seg == filepath.Base(newName) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(w.dir, seg)); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(newName, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	w.cur = f
+	w.bw = bufio.NewWriter(f)
+	w.cw = &countingWriter{w: w.bw}
+	w.enc = gob.NewEncoder(w.cw)
+	return nil
+}
+
+// Close flushes and closes the current segment.
+func (w *wal) Close() error {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if err := w.syncLocked(); err != nil {
+		w.cur.Close()
+		return err
+	}
+	return w.cur.Close()
+}
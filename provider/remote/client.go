@@ -0,0 +1,116 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/alertmanager/types"
+)
+
+const contentTypeProtobuf = "application/x-protobuf"
+
+// client posts batches of alerts to a remote Alertmanager's alerts
+// endpoint and can read its pending set back on demand.
+type client struct {
+	url        string
+	httpClient *http.Client
+	maxBackoff time.Duration
+	deadline   time.Duration
+}
+
+func newClient(url string, maxBackoff, deadline time.Duration) *client {
+	return &client{
+		url:        url,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		maxBackoff: maxBackoff,
+		deadline:   deadline,
+	}
+}
+
+// Store posts a batch of alerts, retrying with exponential backoff until
+// it succeeds or the configured deadline elapses, at which point the
+// batch is dropped.
+func (c *client) Store(alerts []*types.Alert) error {
+	body := marshalAlerts(alerts)
+
+	deadline := time.Now().Add(c.deadline)
+	backoff := 50 * time.Millisecond
+
+	for {
+		err := c.send(body)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("giving up sending batch of %d alerts after %s: %w", len(alerts), c.deadline, err)
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+func (c *client) send(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("remote write to %s failed: %s", c.url, resp.Status)
+	}
+	return nil
+}
+
+// Fetch returns the remote's current pending alert set.
+func (c *client) Fetch() ([]*types.Alert, error) {
+	req, err := http.NewRequest(http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", contentTypeProtobuf)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("remote fetch from %s failed: %s", c.url, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	alerts, err := unmarshalAlerts(body)
+	if err != nil {
+		return nil, fmt.Errorf("decode alerts: %w", err)
+	}
+	return alerts, nil
+}
@@ -0,0 +1,66 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ewmaRate tracks an exponentially weighted moving average of events per
+// second, ticked once per interval. It mirrors the rate tracker
+// Prometheus's remote write queue manager uses to decide when to reshard.
+type ewmaRate struct {
+	newEvents int64 // Accessed atomically.
+
+	alpha    float64
+	interval time.Duration
+
+	mtx      sync.Mutex
+	lastRate float64
+	init     bool
+}
+
+func newEWMARate(alpha float64, interval time.Duration) *ewmaRate {
+	return &ewmaRate{alpha: alpha, interval: interval}
+}
+
+// incr records n events since the last tick.
+func (r *ewmaRate) incr(n int64) {
+	atomic.AddInt64(&r.newEvents, n)
+}
+
+// tick folds the events recorded since the last tick into the rate.
+func (r *ewmaRate) tick() {
+	newEvents := atomic.SwapInt64(&r.newEvents, 0)
+	instant := float64(newEvents) / r.interval.Seconds()
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.init {
+		r.lastRate += r.alpha * (instant - r.lastRate)
+	} else {
+		r.init = true
+		r.lastRate = instant
+	}
+}
+
+// rate returns the current events-per-second estimate.
+func (r *ewmaRate) rate() float64 {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	return r.lastRate
+}
@@ -0,0 +1,219 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/prometheus/alertmanager/types"
+	"github.com/prometheus/common/model"
+)
+
+// Wire format for a batch of alerts, encoded by hand with protowire
+// rather than generated from a .proto, since this package has no
+// protoc-generated types of its own:
+//
+//	AlertBatch   { repeated Alert alerts = 1; }
+//	Alert        { repeated Pair labels = 1; repeated Pair annotations = 2;
+//	               int64 starts_at_unix_nano = 3; int64 ends_at_unix_nano = 4;
+//	               string generator_url = 5; int64 updated_at_unix_nano = 6;
+//	               bool timeout = 7; }
+//	Pair         { string name = 1; string value = 2; }
+
+// marshalAlerts encodes alerts as an AlertBatch message, each Alert in it
+// length-delimited; the batch itself carries no length prefix.
+func marshalAlerts(alerts []*types.Alert) []byte {
+	var buf []byte
+	for _, alert := range alerts {
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, marshalAlert(alert))
+	}
+	return buf
+}
+
+func marshalAlert(alert *types.Alert) []byte {
+	var buf []byte
+	for name, value := range alert.Labels {
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, marshalPair(string(name), string(value)))
+	}
+	for name, value := range alert.Annotations {
+		buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, marshalPair(string(name), string(value)))
+	}
+	buf = protowire.AppendTag(buf, 3, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(alert.StartsAt.UnixNano()))
+	buf = protowire.AppendTag(buf, 4, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(alert.EndsAt.UnixNano()))
+	if alert.GeneratorURL != "" {
+		buf = protowire.AppendTag(buf, 5, protowire.BytesType)
+		buf = protowire.AppendString(buf, alert.GeneratorURL)
+	}
+	buf = protowire.AppendTag(buf, 6, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, uint64(alert.UpdatedAt.UnixNano()))
+	buf = protowire.AppendTag(buf, 7, protowire.VarintType)
+	buf = protowire.AppendVarint(buf, protowire.EncodeBool(alert.Timeout))
+	return buf
+}
+
+func marshalPair(name, value string) []byte {
+	var buf []byte
+	buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+	buf = protowire.AppendString(buf, name)
+	buf = protowire.AppendTag(buf, 2, protowire.BytesType)
+	buf = protowire.AppendString(buf, value)
+	return buf
+}
+
+// unmarshalAlerts decodes an AlertBatch message produced by marshalAlerts.
+func unmarshalAlerts(data []byte) ([]*types.Alert, error) {
+	var alerts []*types.Alert
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num != 1 || typ != protowire.BytesType {
+			return nil, fmt.Errorf("alert batch: unexpected field %d (type %d)", num, typ)
+		}
+		v, n := protowire.ConsumeBytes(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		alert, err := unmarshalAlert(v)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+func unmarshalAlert(data []byte) (*types.Alert, error) {
+	alert := &types.Alert{
+		Alert: model.Alert{
+			Labels:      model.LabelSet{},
+			Annotations: model.LabelSet{},
+		},
+	}
+
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case 1, 2:
+			if typ != protowire.BytesType {
+				return nil, fmt.Errorf("alert: unexpected type %d for field %d", typ, num)
+			}
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+
+			name, value, err := unmarshalPair(v)
+			if err != nil {
+				return nil, err
+			}
+			if num == 1 {
+				alert.Labels[model.LabelName(name)] = model.LabelValue(value)
+			} else {
+				alert.Annotations[model.LabelName(name)] = model.LabelValue(value)
+			}
+		case 3, 4, 6:
+			if typ != protowire.VarintType {
+				return nil, fmt.Errorf("alert: unexpected type %d for field %d", typ, num)
+			}
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+
+			ts := time.Unix(0, int64(v)).UTC()
+			switch num {
+			case 3:
+				alert.StartsAt = ts
+			case 4:
+				alert.EndsAt = ts
+			case 6:
+				alert.UpdatedAt = ts
+			}
+		case 5:
+			if typ != protowire.BytesType {
+				return nil, fmt.Errorf("alert: unexpected type %d for field %d", typ, num)
+			}
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			alert.GeneratorURL = v
+		case 7:
+			if typ != protowire.VarintType {
+				return nil, fmt.Errorf("alert: unexpected type %d for field %d", typ, num)
+			}
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			alert.Timeout = protowire.DecodeBool(v)
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+		}
+	}
+	return alert, nil
+}
+
+func unmarshalPair(data []byte) (name, value string, err error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		data = data[n:]
+		if typ != protowire.BytesType {
+			return "", "", fmt.Errorf("label pair: unexpected type %d for field %d", typ, num)
+		}
+
+		s, n := protowire.ConsumeString(data)
+		if n < 0 {
+			return "", "", protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case 1:
+			name = s
+		case 2:
+			value = s
+		}
+	}
+	return name, value, nil
+}
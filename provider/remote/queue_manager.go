@@ -0,0 +1,335 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/prometheus/alertmanager/types"
+)
+
+const (
+	shardUpdateInterval = 10 * time.Second
+	ewmaAlpha           = 0.2
+	// idleTicksBeforeShrink is how many consecutive near-empty ticks the
+	// queue waits before giving a shard back up, so a brief lull doesn't
+	// thrash shard count on every send.
+	idleTicksBeforeShrink = 3
+	// growthTicksBeforeGrow is how many consecutive over-threshold ticks
+	// the queue waits before adding a shard, so a single momentary spike
+	// doesn't reshard on its own.
+	growthTicksBeforeGrow = 3
+	// idleRateEpsilon is the "effectively zero" threshold for the
+	// pending-samples EWMA: it decays geometrically and in practice
+	// never lands on an exact 0.0, so shrink must compare against a
+	// small threshold instead of equality.
+	idleRateEpsilon = 1e-9
+)
+
+// Config configures a QueueManager.
+type Config struct {
+	// URL of the remote Alertmanager's alerts endpoint.
+	URL string
+	// MaxSamplesPerSend caps how many alerts a single batch carries.
+	MaxSamplesPerSend int
+	// MinShards and MaxShards bound how far the queue can reshard.
+	MinShards int
+	MaxShards int
+	// BatchSendDeadline is how long a shard waits to fill a batch before
+	// flushing a partial one anyway.
+	BatchSendDeadline time.Duration
+	// MaxBackoff bounds the exponential backoff between retries of a
+	// failed send.
+	MaxBackoff time.Duration
+	// Deadline bounds how long a shard keeps retrying a batch before it
+	// is dropped.
+	Deadline time.Duration
+	// OnSendError, if set, is called whenever a shard fails to ship a
+	// batch - including the case where it gives up after Deadline and
+	// drops the batch - so a caller can observe replication failures
+	// (log them, count them in a metric) instead of them vanishing
+	// silently.
+	OnSendError func(err error)
+}
+
+// DefaultConfig returns sane defaults for Config, modeled on Prometheus's
+// remote write queue manager.
+func DefaultConfig() Config {
+	return Config{
+		MaxSamplesPerSend: 100,
+		MinShards:         1,
+		MaxShards:         50,
+		BatchSendDeadline: 5 * time.Second,
+		MaxBackoff:        5 * time.Second,
+		Deadline:          30 * time.Second,
+	}
+}
+
+// QueueManager ships alerts to a single remote endpoint through a bank
+// of shards, growing or shrinking the shard count to keep the backlog of
+// pending alerts bounded.
+type QueueManager struct {
+	cfg    Config
+	client *client
+
+	mtx       sync.Mutex
+	shards    []*shard
+	numShards int
+
+	samplesIn      *ewmaRate
+	samplesOut     *ewmaRate
+	samplesPending *ewmaRate
+
+	limiter *rate.Limiter
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewQueueManager returns a QueueManager for cfg. Call Start to begin
+// delivering alerts appended via Append.
+func NewQueueManager(cfg Config) *QueueManager {
+	t := &QueueManager{
+		cfg:            cfg,
+		client:         newClient(cfg.URL, cfg.MaxBackoff, cfg.Deadline),
+		numShards:      cfg.MinShards,
+		samplesIn:      newEWMARate(ewmaAlpha, shardUpdateInterval),
+		samplesOut:     newEWMARate(ewmaAlpha, shardUpdateInterval),
+		samplesPending: newEWMARate(ewmaAlpha, shardUpdateInterval),
+		limiter:        rate.NewLimiter(rate.Limit(cfg.MaxSamplesPerSend*cfg.MaxShards), cfg.MaxSamplesPerSend),
+		quit:           make(chan struct{}),
+	}
+	t.shards = t.newShards(t.numShards)
+	return t
+}
+
+// Start launches the shards and the resharding loop.
+func (t *QueueManager) Start() {
+	for _, s := range t.shards {
+		s.start()
+	}
+	t.wg.Add(1)
+	go t.reshardLoop()
+}
+
+// Stop drains and stops every shard.
+func (t *QueueManager) Stop() {
+	close(t.quit)
+	t.wg.Wait()
+
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	for _, s := range t.shards {
+		s.stop()
+	}
+}
+
+// Append enqueues alerts for delivery. Each alert is routed to a shard
+// by fingerprint so repeated updates to the same alert always ship in
+// order.
+func (t *QueueManager) Append(alerts ...*types.Alert) error {
+	t.samplesIn.incr(int64(len(alerts)))
+
+	t.mtx.Lock()
+	shards := t.shards
+	t.mtx.Unlock()
+
+	for _, a := range alerts {
+		s := shards[uint64(a.Fingerprint())%uint64(len(shards))]
+		select {
+		case s.queue <- a:
+			t.samplesPending.incr(1)
+		case <-t.quit:
+			return fmt.Errorf("queue manager for %s stopped", t.cfg.URL)
+		}
+	}
+	return nil
+}
+
+func (t *QueueManager) reshardLoop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(shardUpdateInterval)
+	defer ticker.Stop()
+
+	var idleTicks, growthTicks int
+	for {
+		select {
+		case <-t.quit:
+			return
+		case <-ticker.C:
+			t.samplesIn.tick()
+			t.samplesOut.tick()
+			t.samplesPending.tick()
+
+			desired := t.calculateDesiredShards(&growthTicks, &idleTicks)
+			if desired != t.numShards {
+				t.reshard(desired)
+			}
+		}
+	}
+}
+
+// calculateDesiredShards grows the shard count by one after
+// growthTicksBeforeGrow consecutive ticks where the pending backlog
+// outgrows what the current shards can drain in one send, and shrinks
+// it by one after idleTicksBeforeShrink consecutive ticks with
+// (effectively) nothing pending, so neither direction reshards off a
+// single momentary tick.
+func (t *QueueManager) calculateDesiredShards(growthTicks, idleTicks *int) int {
+	pending := t.samplesPending.rate() * shardUpdateInterval.Seconds()
+
+	desired := t.numShards
+	switch {
+	case pending > float64(t.numShards*t.cfg.MaxSamplesPerSend):
+		*idleTicks = 0
+		*growthTicks++
+		if *growthTicks >= growthTicksBeforeGrow {
+			desired = t.numShards + 1
+			*growthTicks = 0
+		}
+	case pending > -idleRateEpsilon && pending < idleRateEpsilon:
+		*growthTicks = 0
+		*idleTicks++
+		if *idleTicks >= idleTicksBeforeShrink {
+			desired = t.numShards - 1
+			*idleTicks = 0
+		}
+	default:
+		*growthTicks = 0
+		*idleTicks = 0
+	}
+
+	if desired < t.cfg.MinShards {
+		desired = t.cfg.MinShards
+	}
+	if desired > t.cfg.MaxShards {
+		desired = t.cfg.MaxShards
+	}
+	return desired
+}
+
+func (t *QueueManager) reshard(n int) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	oldShards := t.shards
+	newShards := t.newShards(n)
+	for _, s := range newShards {
+		s.start()
+	}
+
+	t.shards = newShards
+	t.numShards = n
+
+	for _, s := range oldShards {
+		s.stop()
+	}
+}
+
+// reportSendError forwards err to cfg.OnSendError, if set, so a dropped
+// or failed batch is observable instead of silently discarded.
+func (t *QueueManager) reportSendError(err error) {
+	if t.cfg.OnSendError != nil {
+		t.cfg.OnSendError(err)
+	}
+}
+
+func (t *QueueManager) newShards(n int) []*shard {
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{
+			qm:    t,
+			queue: make(chan *types.Alert, t.cfg.MaxSamplesPerSend*10),
+			quit:  make(chan struct{}),
+			done:  make(chan struct{}),
+		}
+	}
+	return shards
+}
+
+// shard drains its queue into batches of at most cfg.MaxSamplesPerSend,
+// flushing early if cfg.BatchSendDeadline elapses first.
+type shard struct {
+	qm    *QueueManager
+	queue chan *types.Alert
+	quit  chan struct{}
+	done  chan struct{}
+}
+
+func (s *shard) start() {
+	go s.run()
+}
+
+func (s *shard) stop() {
+	close(s.quit)
+	<-s.done
+}
+
+func (s *shard) run() {
+	defer close(s.done)
+
+	batch := make([]*types.Alert, 0, s.qm.cfg.MaxSamplesPerSend)
+	timer := time.NewTimer(s.qm.cfg.BatchSendDeadline)
+	defer timer.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.qm.limiter.WaitN(context.Background(), len(batch)); err != nil {
+			s.qm.reportSendError(fmt.Errorf("rate limiter: %w", err))
+		} else if err := s.qm.client.Store(batch); err != nil {
+			s.qm.reportSendError(fmt.Errorf("send batch of %d alerts: %w", len(batch), err))
+		}
+		s.qm.samplesOut.incr(int64(len(batch)))
+		s.qm.samplesPending.incr(-int64(len(batch)))
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case <-s.quit:
+			// Drain whatever is already queued without blocking so a
+			// reshard or shutdown doesn't silently drop in-flight alerts.
+			for drained := false; !drained; {
+				select {
+				case a := <-s.queue:
+					batch = append(batch, a)
+					if len(batch) >= s.qm.cfg.MaxSamplesPerSend {
+						flush()
+					}
+				default:
+					drained = true
+				}
+			}
+			flush()
+			return
+		case a := <-s.queue:
+			batch = append(batch, a)
+			if len(batch) >= s.qm.cfg.MaxSamplesPerSend {
+				flush()
+				timer.Reset(s.qm.cfg.BatchSendDeadline)
+			}
+		case <-timer.C:
+			flush()
+			timer.Reset(s.qm.cfg.BatchSendDeadline)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import "testing"
+
+func TestCalculateDesiredShardsGrowthNeedsConsecutiveTicks(t *testing.T) {
+	qm := &QueueManager{
+		cfg:       Config{MaxSamplesPerSend: 10, MinShards: 1, MaxShards: 10},
+		numShards: 1,
+	}
+	// Force the pending rate high enough to be over threshold on every
+	// tick without needing real time to pass.
+	qm.samplesPending = newEWMARate(1, shardUpdateInterval)
+	qm.samplesPending.lastRate = 100 // samples/sec, well over 1*10 per tick.
+	qm.samplesPending.init = true
+
+	var growthTicks, idleTicks int
+	for i := 0; i < growthTicksBeforeGrow-1; i++ {
+		if got := qm.calculateDesiredShards(&growthTicks, &idleTicks); got != qm.numShards {
+			t.Fatalf("tick %d: calculateDesiredShards() = %d, want unchanged %d before growthTicksBeforeGrow ticks", i, got, qm.numShards)
+		}
+	}
+
+	got := qm.calculateDesiredShards(&growthTicks, &idleTicks)
+	if want := qm.numShards + 1; got != want {
+		t.Fatalf("calculateDesiredShards() after growthTicksBeforeGrow consecutive over-threshold ticks = %d, want %d", got, want)
+	}
+}
+
+func TestCalculateDesiredShardsShrinksOnNearZeroRate(t *testing.T) {
+	qm := &QueueManager{
+		cfg:       Config{MaxSamplesPerSend: 10, MinShards: 1, MaxShards: 10},
+		numShards: 2,
+	}
+	qm.samplesPending = newEWMARate(1, shardUpdateInterval)
+	// An EWMA that has decayed close to, but never exactly, zero must
+	// still be treated as idle.
+	qm.samplesPending.lastRate = 1e-12
+	qm.samplesPending.init = true
+
+	var growthTicks, idleTicks int
+	for i := 0; i < idleTicksBeforeShrink-1; i++ {
+		if got := qm.calculateDesiredShards(&growthTicks, &idleTicks); got != qm.numShards {
+			t.Fatalf("tick %d: calculateDesiredShards() = %d, want unchanged %d before idleTicksBeforeShrink ticks", i, got, qm.numShards)
+		}
+	}
+
+	got := qm.calculateDesiredShards(&growthTicks, &idleTicks)
+	if want := qm.numShards - 1; got != want {
+		t.Fatalf("calculateDesiredShards() after idleTicksBeforeShrink consecutive near-zero ticks = %d, want %d", got, want)
+	}
+}
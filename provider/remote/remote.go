@@ -0,0 +1,110 @@
+// Copyright 2016 Prometheus Team
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/lic:wenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote ships alerts to a remote Alertmanager over HTTP and can
+// read its pending set back on demand, so multi-region deployments can
+// replicate alerts without relying solely on the gossip mesh. It is
+// meant to be plugged in as a secondary behind provider/fanout.
+//
+// This package implements only the client side of the wire format
+// described in pb.go: it POSTs an AlertBatch to cfg.URL and expects a GET
+// against the same URL to return one back. The receiving Alertmanager
+// needs a handler that speaks that same format at that endpoint; no such
+// handler exists in this tree yet, so a remote.Alerts has nothing to
+// replicate to until one is added on the receiving side.
+package remote
+
+import (
+	"time"
+
+	"github.com/prometheus/alertmanager/provider/mem"
+	"github.com/prometheus/alertmanager/types"
+)
+
+// Alerts is a provider.Alerts that mirrors every Put to a remote
+// Alertmanager through a QueueManager, and periodically pulls the
+// remote's pending set into a local mem.Alerts cache so Get, GetPending
+// and Subscribe have something to serve without a round trip per call.
+type Alerts struct {
+	*mem.Alerts
+
+	qm           *QueueManager
+	client       *client
+	intervalPull time.Duration
+	stop         chan struct{}
+}
+
+// NewAlerts returns a provider.Alerts that replicates to the remote
+// Alertmanager described by cfg. intervalGC governs the local cache's
+// own eviction of resolved alerts; intervalPull governs how often the
+// remote's pending set is fetched back into that cache.
+func NewAlerts(cfg Config, m types.Marker, intervalGC, intervalPull time.Duration) (*Alerts, error) {
+	cache, err := mem.NewAlerts(m, intervalGC)
+	if err != nil {
+		return nil, err
+	}
+
+	qm := NewQueueManager(cfg)
+	qm.Start()
+
+	a := &Alerts{
+		Alerts:       cache,
+		qm:           qm,
+		client:       newClient(cfg.URL, cfg.MaxBackoff, cfg.Deadline),
+		intervalPull: intervalPull,
+		stop:         make(chan struct{}),
+	}
+	go a.pull()
+
+	return a, nil
+}
+
+// Put mirrors alerts into the local cache and enqueues them for
+// replication to the remote Alertmanager.
+func (a *Alerts) Put(alerts ...*types.Alert) error {
+	if err := a.Alerts.Put(alerts...); err != nil {
+		return err
+	}
+	return a.qm.Append(alerts...)
+}
+
+// pull periodically fetches the remote's pending alert set and merges it
+// into the local cache, healing anything this Alertmanager missed.
+func (a *Alerts) pull() {
+	t := time.NewTicker(a.intervalPull)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-a.stop:
+			return
+		case <-t.C:
+			alerts, err := a.client.Fetch()
+			if err != nil {
+				// Best effort; the remote is retried on the next tick.
+				continue
+			}
+			if len(alerts) > 0 {
+				a.Alerts.Put(alerts...)
+			}
+		}
+	}
+}
+
+// Close stops the background puller and the queue manager in addition to
+// the embedded mem.Alerts' own GC loop.
+func (a *Alerts) Close() error {
+	close(a.stop)
+	a.qm.Stop()
+	return a.Alerts.Close()
+}